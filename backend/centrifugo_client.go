@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// APIError mirrors the {code, message} error shape returned by Centrifugo's
+// server API when a call fails (e.g. unknown channel, bad request).
+type APIError struct {
+	Code    uint32 `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Centrifugo API error %d: %s", e.Code, e.Message)
+}
+
+// apiEnvelope is the common {result, error} envelope Centrifugo wraps every
+// server API response in.
+type apiEnvelope struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *APIError       `json:"error,omitempty"`
+}
+
+// CentrifugoClient talks to Centrifugo's HTTP server API
+// (https://centrifugal.dev/docs/server/server_api). It replaces the old
+// standalone publishToCentrifugo helper with one typed method per API call.
+type CentrifugoClient struct {
+	URL        string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// NewCentrifugoClient builds a client from the app's Centrifugo config.
+func NewCentrifugoClient(cfg CentrifugoConfig) *CentrifugoClient {
+	return &CentrifugoClient{
+		URL:        cfg.URL,
+		APIKey:     cfg.APIKey,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// call POSTs req (JSON-encoded) to /api/<method> and decodes the result into
+// out. out may be nil when the caller doesn't care about the result payload.
+func (c *CentrifugoClient) call(method string, req interface{}, out interface{}) error {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %v", method, err)
+	}
+
+	url := fmt.Sprintf("%s/api/%s", c.URL, method)
+	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "apikey "+c.APIKey)
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send request to Centrifugo: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Centrifugo response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Centrifugo API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var env apiEnvelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return fmt.Errorf("failed to decode Centrifugo response: %v", err)
+	}
+	if env.Error != nil {
+		return env.Error
+	}
+
+	if out != nil && len(env.Result) > 0 {
+		if err := json.Unmarshal(env.Result, out); err != nil {
+			return fmt.Errorf("failed to decode %s result: %v", method, err)
+		}
+	}
+
+	return nil
+}
+
+// StreamPosition identifies an offset within a channel's history stream.
+type StreamPosition struct {
+	Offset uint64 `json:"offset"`
+	Epoch  string `json:"epoch"`
+}
+
+// ClientInfo describes a single connection, as returned by presence/history.
+type ClientInfo struct {
+	User     string          `json:"user"`
+	Client   string          `json:"client"`
+	ConnInfo json.RawMessage `json:"conn_info,omitempty"`
+	ChanInfo json.RawMessage `json:"chan_info,omitempty"`
+}
+
+// PublishResult is returned by Publish and by each per-channel response in a
+// Broadcast result.
+type PublishResult struct {
+	Offset uint64 `json:"offset,omitempty"`
+	Epoch  string `json:"epoch,omitempty"`
+}
+
+// Publish sends data to a single channel via Centrifugo's publish API.
+func (c *CentrifugoClient) Publish(channel string, data interface{}) (*PublishResult, error) {
+	req := struct {
+		Channel string      `json:"channel"`
+		Data    interface{} `json:"data"`
+	}{Channel: channel, Data: data}
+
+	var result PublishResult
+	if err := c.call("publish", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// BroadcastResponse is the per-channel outcome of a Broadcast call.
+type BroadcastResponse struct {
+	Error  *APIError      `json:"error,omitempty"`
+	Result *PublishResult `json:"result,omitempty"`
+}
+
+// BroadcastResult is returned by Broadcast.
+type BroadcastResult struct {
+	Responses []BroadcastResponse `json:"responses"`
+}
+
+// Broadcast publishes the same data to many channels in a single Centrifugo
+// API call.
+func (c *CentrifugoClient) Broadcast(channels []string, data interface{}) (*BroadcastResult, error) {
+	req := struct {
+		Channels []string    `json:"channels"`
+		Data     interface{} `json:"data"`
+	}{Channels: channels, Data: data}
+
+	var result BroadcastResult
+	if err := c.call("broadcast", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PublishCommand is a single publish call embedded in a Batch request.
+type PublishCommand struct {
+	Channel string      `json:"channel"`
+	Data    interface{} `json:"data"`
+}
+
+// BatchCommand is one entry of a Batch request. Only Publish is populated
+// today; Centrifugo's batch API accepts other command kinds (presence,
+// history, ...) the same way, so more fields can be added here as needed.
+type BatchCommand struct {
+	Publish *PublishCommand `json:"publish,omitempty"`
+}
+
+// BatchReply is the per-command outcome of a Batch call, in the same order
+// commands were submitted.
+type BatchReply struct {
+	Publish *struct {
+		Result *PublishResult `json:"result,omitempty"`
+		Error  *APIError      `json:"error,omitempty"`
+	} `json:"publish,omitempty"`
+	Error *APIError `json:"error,omitempty"`
+}
+
+// BatchResult is returned by Batch.
+type BatchResult struct {
+	Replies []BatchReply `json:"replies"`
+}
+
+// Batch submits multiple distinct commands (e.g. N publishes with different
+// data to different channels) in a single Centrifugo API call, rather than
+// one HTTP round trip per command. Unlike Broadcast, each command's data can
+// differ, which is what per-channel-encrypted publishes need.
+func (c *CentrifugoClient) Batch(commands []BatchCommand) (*BatchResult, error) {
+	req := struct {
+		Commands []BatchCommand `json:"commands"`
+	}{Commands: commands}
+
+	var result BatchResult
+	if err := c.call("batch", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PresenceResult is returned by Presence: the set of clients currently
+// subscribed to a channel, keyed by client ID.
+type PresenceResult struct {
+	Presence map[string]ClientInfo `json:"presence"`
+}
+
+// Presence returns the list of active clients in a channel.
+func (c *CentrifugoClient) Presence(channel string) (*PresenceResult, error) {
+	req := struct {
+		Channel string `json:"channel"`
+	}{Channel: channel}
+
+	var result PresenceResult
+	if err := c.call("presence", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PresenceStatsResult is returned by PresenceStats.
+type PresenceStatsResult struct {
+	NumClients uint32 `json:"num_clients"`
+	NumUsers   uint32 `json:"num_users"`
+}
+
+// PresenceStats returns aggregate client/user counts for a channel without
+// the full per-client presence payload.
+func (c *CentrifugoClient) PresenceStats(channel string) (*PresenceStatsResult, error) {
+	req := struct {
+		Channel string `json:"channel"`
+	}{Channel: channel}
+
+	var result PresenceStatsResult
+	if err := c.call("presence_stats", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Publication is a single historical message returned by History.
+type Publication struct {
+	Data   json.RawMessage `json:"data"`
+	Offset uint64          `json:"offset,omitempty"`
+	Info   *ClientInfo     `json:"info,omitempty"`
+}
+
+// HistoryResult is returned by History.
+type HistoryResult struct {
+	Publications []Publication `json:"publications"`
+	Offset       uint64        `json:"offset,omitempty"`
+	Epoch        string        `json:"epoch,omitempty"`
+}
+
+// History returns recent publications for a channel. limit <= 0 asks
+// Centrifugo for its default page size; since, if non-nil, returns only
+// publications after that stream position.
+func (c *CentrifugoClient) History(channel string, limit int, since *StreamPosition, reverse bool) (*HistoryResult, error) {
+	req := struct {
+		Channel string          `json:"channel"`
+		Limit   int             `json:"limit,omitempty"`
+		Since   *StreamPosition `json:"since,omitempty"`
+		Reverse bool            `json:"reverse,omitempty"`
+	}{Channel: channel, Limit: limit, Since: since, Reverse: reverse}
+
+	var result HistoryResult
+	if err := c.call("history", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// HistoryRemove clears the history stream for a channel.
+func (c *CentrifugoClient) HistoryRemove(channel string) error {
+	req := struct {
+		Channel string `json:"channel"`
+	}{Channel: channel}
+
+	return c.call("history_remove", req, nil)
+}
+
+// ChannelInfo is the per-channel payload returned by Channels.
+type ChannelInfo struct {
+	NumClients uint32 `json:"num_clients"`
+}
+
+// ChannelsResult is returned by Channels.
+type ChannelsResult struct {
+	Channels map[string]ChannelInfo `json:"channels"`
+}
+
+// Channels lists currently active channels, optionally filtered by a glob
+// pattern understood by Centrifugo.
+func (c *CentrifugoClient) Channels(pattern string) (*ChannelsResult, error) {
+	req := struct {
+		Pattern string `json:"pattern,omitempty"`
+	}{Pattern: pattern}
+
+	var result ChannelsResult
+	if err := c.call("channels", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Subscribe subscribes a user (optionally a specific client connection) to a
+// channel from the server side.
+func (c *CentrifugoClient) Subscribe(user, channel, client string) error {
+	req := struct {
+		User    string `json:"user"`
+		Channel string `json:"channel"`
+		Client  string `json:"client,omitempty"`
+	}{User: user, Channel: channel, Client: client}
+
+	return c.call("subscribe", req, nil)
+}
+
+// Unsubscribe removes a user (optionally a specific client connection) from a
+// channel from the server side.
+func (c *CentrifugoClient) Unsubscribe(user, channel, client string) error {
+	req := struct {
+		User    string `json:"user"`
+		Channel string `json:"channel"`
+		Client  string `json:"client,omitempty"`
+	}{User: user, Channel: channel, Client: client}
+
+	return c.call("unsubscribe", req, nil)
+}
+
+// Disconnect forcibly disconnects a user's connections.
+func (c *CentrifugoClient) Disconnect(user, client string) error {
+	req := struct {
+		User   string `json:"user"`
+		Client string `json:"client,omitempty"`
+	}{User: user, Client: client}
+
+	return c.call("disconnect", req, nil)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// maxMessageContentBytes bounds message size before it ever reaches the
+// encryption step, so a single oversized payload can't be used to hog
+// memory or CPU deriving/sealing.
+const maxMessageContentBytes = 100 * 1024
+
+// messageHKDFInfo scopes derived topic keys to this application, so the
+// same master key reused elsewhere wouldn't produce the same key stream.
+const messageHKDFInfo = "centrifugo-example-message-key"
+
+// messageEnvelope is the ciphertext payload published in place of plaintext
+// Message.Content, so Centrifugo (and anything that can read the bus) only
+// ever sees opaque bytes.
+type messageEnvelope struct {
+	V     int    `json:"v"`
+	Alg   string `json:"alg"`
+	Nonce string `json:"nonce"`
+	CT    string `json:"ct"`
+	Tag   string `json:"tag"`
+}
+
+// messageMasterKey seeds every per-topic key via HKDF. It should be set to a
+// high-entropy secret in production; the default is only for local demos.
+var messageMasterKey = deriveMasterKey(getEnv("MESSAGE_ENCRYPTION_MASTER_KEY", "message_encryption_master_key"))
+
+func deriveMasterKey(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// topicKey derives a per-topic AES-256 key from messageMasterKey via
+// HKDF-SHA256, so compromising one topic's key doesn't expose any other
+// topic's history.
+func topicKey(topic string) ([]byte, error) {
+	key := make([]byte, 32)
+	kdf := hkdf.New(sha256.New, messageMasterKey, []byte(topic), []byte(messageHKDFInfo))
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, fmt.Errorf("failed to derive topic key: %v", err)
+	}
+	return key, nil
+}
+
+// encryptMessageContent seals content under topic's derived key, binding
+// associatedData (expected to be "topic|author|id") so ciphertext can't be
+// replayed against a different topic, author or message ID.
+func encryptMessageContent(topic, content string, associatedData []byte) (*messageEnvelope, error) {
+	if len(content) > maxMessageContentBytes {
+		return nil, fmt.Errorf("message content exceeds %d bytes", maxMessageContentBytes)
+	}
+
+	key, err := topicKey(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %v", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	sealed := gcm.Seal(nil, nonce, []byte(content), associatedData)
+	ct, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return &messageEnvelope{
+		V:     1,
+		Alg:   "aes-gcm",
+		Nonce: base64.StdEncoding.EncodeToString(nonce),
+		CT:    base64.StdEncoding.EncodeToString(ct),
+		Tag:   base64.StdEncoding.EncodeToString(tag),
+	}, nil
+}
+
+// encryptedMessage mirrors Message but carries an encrypted envelope in
+// place of plaintext Content; it's what actually gets published to
+// Centrifugo so a compromised Centrifugo node never sees message content.
+type encryptedMessage struct {
+	ID        string           `json:"id"`
+	Topic     string           `json:"topic"`
+	Content   *messageEnvelope `json:"content"`
+	Author    string           `json:"author"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// encryptMessageForTopic encrypts message.Content for topic and returns the
+// encryptedMessage that should be published in its place. It does not talk
+// to Centrifugo itself, so callers can route the result through the publish
+// pool.
+func encryptMessageForTopic(topic string, message Message) (encryptedMessage, error) {
+	associatedData := []byte(fmt.Sprintf("%s|%s|%s", topic, message.Author, message.ID))
+	envelope, err := encryptMessageContent(topic, message.Content, associatedData)
+	if err != nil {
+		return encryptedMessage{}, fmt.Errorf("failed to encrypt message: %v", err)
+	}
+
+	return encryptedMessage{
+		ID:        message.ID,
+		Topic:     topic,
+		Content:   envelope,
+		Author:    message.Author,
+		Timestamp: message.Timestamp,
+	}, nil
+}
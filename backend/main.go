@@ -1,10 +1,7 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
@@ -12,7 +9,6 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type Message struct {
@@ -23,37 +19,28 @@ type Message struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
-type PublishRequest struct {
-	Channel string      `json:"channel"`
-	Data    interface{} `json:"data"`
-}
-
 type SendMessageRequest struct {
 	Topic   string `json:"topic"`
 	Content string `json:"content"`
 	Author  string `json:"author"`
 }
 
-type TokenRequest struct {
-	User string `json:"user"`
-}
-
-type TokenResponse struct {
-	Token string `json:"token"`
-}
-
 type CentrifugoConfig struct {
 	URL       string
 	APIKey    string
 	TokenHMACSecretKey string
+	ProxyAPIKey string
 }
 
 var centrifugoConfig = CentrifugoConfig{
 	URL:                getEnv("CENTRIFUGO_URL", "http://localhost:8000"),
 	APIKey:             getEnv("CENTRIFUGO_API_KEY", "api_key"),
 	TokenHMACSecretKey: getEnv("CENTRIFUGO_TOKEN_HMAC_SECRET_KEY", "token_hmac_secret_key"),
+	ProxyAPIKey:        getEnv("CENTRIFUGO_PROXY_API_KEY", ""),
 }
 
+var centrifugoClient = NewCentrifugoClient(centrifugoConfig)
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -61,83 +48,6 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-func generateToken(user string) (string, error) {
-	// Create the claims
-	claims := jwt.MapClaims{
-		"sub": user,                                    // Subject (user identifier)
-		"iat": time.Now().Unix(),                      // Issued at
-		"exp": time.Now().Add(24 * time.Hour).Unix(),  // Expires in 24 hours
-	}
-
-	// Create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign token with secret
-	tokenString, err := token.SignedString([]byte(centrifugoConfig.TokenHMACSecretKey))
-	if err != nil {
-		return "", fmt.Errorf("failed to sign token: %v", err)
-	}
-
-	return tokenString, nil
-}
-
-func getToken(c *gin.Context) {
-	var req TokenRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
-		return
-	}
-
-	if req.User == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User is required"})
-		return
-	}
-
-	token, err := generateToken(req.User)
-	if err != nil {
-		log.Printf("Failed to generate token: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
-	}
-
-	c.JSON(http.StatusOK, TokenResponse{Token: token})
-}
-
-func publishToCentrifugo(channel string, data interface{}) error {
-	publishReq := PublishRequest{
-		Channel: channel,
-		Data:    data,
-	}
-
-	jsonData, err := json.Marshal(publishReq)
-	if err != nil {
-		return fmt.Errorf("failed to marshal publish request: %v", err)
-	}
-
-	url := fmt.Sprintf("%s/api/publish", centrifugoConfig.URL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "apikey "+centrifugoConfig.APIKey)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request to Centrifugo: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("Centrifugo API error: %d - %s", resp.StatusCode, string(body))
-	}
-
-	return nil
-}
-
 func sendMessage(c *gin.Context) {
 	var req SendMessageRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -158,40 +68,85 @@ func sendMessage(c *gin.Context) {
 		Timestamp: time.Now(),
 	}
 
-	// Special handling for "all" channel: broadcast to all channels
+	// Destination topics for this message: either every topic channel (the
+	// special "all" topic), or the specific topic plus "all" to aggregate
+	// it there too. Each needs its own ciphertext (topicKey differs per
+	// topic), so these become N distinct publish commands sent to
+	// Centrifugo as batch calls, one per worker queue the channels route
+	// to, rather than N separate publish requests.
+	topics := []string{req.Topic, "all"}
 	if req.Topic == "all" {
-		// Get all available topics
-		topics := []string{"all", "general", "tech", "random", "announcements"}
-		
-		// Publish to all topic channels
-		for _, topic := range topics {
-			channelName := fmt.Sprintf("topic:%s", topic)
-			if err := publishToCentrifugo(channelName, message); err != nil {
-				log.Printf("Failed to publish to '%s' topic: %v", topic, err)
-				// Continue publishing to other channels even if one fails
-			}
-		}
-	} else {
-		// Normal behavior: publish to specific topic channel
-		channelName := fmt.Sprintf("topic:%s", req.Topic)
-		if err := publishToCentrifugo(channelName, message); err != nil {
-			log.Printf("Failed to publish to Centrifugo: %v", err)
+		topics = []string{"all", "general", "tech", "random", "announcements"}
+	}
+
+	commands := make([]BatchCommand, 0, len(topics))
+	for _, topic := range topics {
+		envelope, err := encryptMessageForTopic(topic, message)
+		if err != nil {
+			log.Printf("Failed to encrypt message for topic '%s': %v", topic, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
 			return
 		}
+		commands = append(commands, BatchCommand{Publish: &PublishCommand{Channel: topicChannel(topic), Data: envelope}})
+	}
 
-		// Also publish to the "all" topic channel to aggregate messages from all other topics
-		allChannelName := "topic:all"
-		if err := publishToCentrifugo(allChannelName, message); err != nil {
-			log.Printf("Failed to publish to 'all' topic: %v", err)
-			// Don't fail the request if publishing to "all" fails
+	batchResult, err := publishPool.PublishBatch(commands)
+	if err != nil {
+		log.Printf("Failed to publish batch to Centrifugo: %v", err)
+		if err == errCircuitOpen {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Centrifugo publishing is temporarily unavailable"})
+			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	var recovery *PublishResult
+	var failures []gin.H
+
+	for i, topic := range topics {
+		var reply BatchReply
+		if i < len(batchResult.Replies) {
+			reply = batchResult.Replies[i]
+		}
+
+		replyErr := reply.Error
+		if replyErr == nil && reply.Publish != nil {
+			replyErr = reply.Publish.Error
+		}
+
+		if replyErr != nil {
+			log.Printf("Failed to publish to '%s' topic: %v", topic, replyErr)
+			failures = append(failures, gin.H{"channel": topicChannel(topic), "error": replyErr.Error()})
+			// Failing to publish the specifically requested topic fails the
+			// whole request, unless that topic is "all"; every other
+			// destination (including "all" when it's only there to
+			// aggregate) is best-effort.
+			if topic == req.Topic && req.Topic != "all" {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+				return
+			}
+			continue
+		}
+
+		if topic == req.Topic && reply.Publish != nil {
+			recovery = reply.Publish.Result
+		}
+	}
+
+	response := gin.H{
 		"success": true,
 		"message": message,
-	})
+	}
+	if recovery != nil {
+		response["offset"] = recovery.Offset
+		response["epoch"] = recovery.Epoch
+	}
+	if len(failures) > 0 {
+		response["publish_failures"] = failures
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 func getTopics(c *gin.Context) {
@@ -224,6 +179,19 @@ func main() {
 	r.GET("/api/topics", getTopics)
 	r.POST("/api/messages", sendMessage)
 	r.POST("/api/token", getToken)
+	r.POST("/api/subscription_token", getSubscriptionToken)
+	r.GET("/api/topics/:topic/presence", getTopicPresence)
+	r.GET("/api/topics/:topic/history", getTopicHistory)
+	r.GET("/api/topics/:topic/stats", getTopicStats)
+	r.GET("/api/topics/:topic/key", requireToken, getTopicKey)
+	r.GET("/metrics", metricsHandler)
+
+	proxy := r.Group("/centrifugo/proxy", verifyProxyAPIKey)
+	proxy.POST("/connect", proxyConnect)
+	proxy.POST("/subscribe", proxySubscribe)
+	proxy.POST("/publish", proxyPublish)
+	proxy.POST("/refresh", proxyRefresh)
+	proxy.POST("/sub_refresh", proxySubRefresh)
 
 	port := getEnv("PORT", "8080")
 	log.Printf("Starting server on port %s", port)
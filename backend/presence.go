@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// topicChannel maps a topic name from the URL to the Centrifugo channel it
+// is published on.
+func topicChannel(topic string) string {
+	return fmt.Sprintf("topic:%s", topic)
+}
+
+// getTopicPresence handles GET /api/topics/:topic/presence, returning the
+// list of clients currently subscribed to the topic's channel.
+func getTopicPresence(c *gin.Context) {
+	topic := c.Param("topic")
+	result, err := centrifugoClient.Presence(topicChannel(topic))
+	if err != nil {
+		log.Printf("Failed to fetch presence for topic '%s': %v", topic, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch presence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// getTopicStats handles GET /api/topics/:topic/stats, returning aggregate
+// client/user counts for the topic's channel.
+func getTopicStats(c *gin.Context) {
+	topic := c.Param("topic")
+	result, err := centrifugoClient.PresenceStats(topicChannel(topic))
+	if err != nil {
+		log.Printf("Failed to fetch presence stats for topic '%s': %v", topic, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch presence stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// getTopicHistory handles GET /api/topics/:topic/history?limit=&since=,
+// where since is an "offset:epoch" stream position, as previously returned
+// alongside a published message.
+func getTopicHistory(c *gin.Context) {
+	topic := c.Param("topic")
+
+	limit := 0
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = parsed
+	}
+
+	var since *StreamPosition
+	if sinceParam := c.Query("since"); sinceParam != "" {
+		pos, err := parseStreamPosition(sinceParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since"})
+			return
+		}
+		since = pos
+	}
+
+	result, err := centrifugoClient.History(topicChannel(topic), limit, since, false)
+	if err != nil {
+		log.Printf("Failed to fetch history for topic '%s': %v", topic, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// getTopicKey handles GET /api/topics/:topic/key, returning the base64
+// encoded per-topic key clients need to decrypt message envelopes published
+// on that topic.
+func getTopicKey(c *gin.Context) {
+	topic := c.Param("topic")
+	if !tokenPolicy.isAllowedChannel(topic) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Topic is not allowed"})
+		return
+	}
+
+	key, err := topicKey(topic)
+	if err != nil {
+		log.Printf("Failed to derive key for topic '%s': %v", topic, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to derive topic key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"topic": topic,
+		"key":   base64.StdEncoding.EncodeToString(key),
+	})
+}
+
+// parseStreamPosition parses a "offset:epoch" string as used in the since
+// query parameter.
+func parseStreamPosition(s string) (*StreamPosition, error) {
+	var offsetStr, epoch string
+	sep := -1
+	for i := 0; i < len(s); i++ {
+		if s[i] == ':' {
+			sep = i
+			break
+		}
+	}
+	if sep < 0 {
+		return nil, fmt.Errorf("since must be in the form offset:epoch")
+	}
+	offsetStr = s[:sep]
+	epoch = s[sep+1:]
+
+	offset, err := strconv.ParseUint(offsetStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid offset: %v", err)
+	}
+
+	return &StreamPosition{Offset: offset, Epoch: epoch}, nil
+}
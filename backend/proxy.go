@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProxyError is the {code, message, temporary} shape Centrifugo expects when
+// a proxy handler rejects a request without disconnecting the client.
+type ProxyError struct {
+	Code      uint32 `json:"code"`
+	Message   string `json:"message"`
+	Temporary bool   `json:"temporary,omitempty"`
+}
+
+// ProxyDisconnect is the {code, reason, reconnect} shape Centrifugo expects
+// when a proxy handler wants to terminate the client connection outright.
+type ProxyDisconnect struct {
+	Code      uint32 `json:"code"`
+	Reason    string `json:"reason"`
+	Reconnect bool   `json:"reconnect"`
+}
+
+// writeProxyResponse renders exactly one of result, proxyErr or disconnect as
+// the {result}/{error}/{disconnect} envelope Centrifugo's proxy contract
+// expects: disconnect takes priority over proxyErr, and proxyErr over result.
+func writeProxyResponse(c *gin.Context, result interface{}, proxyErr *ProxyError, disconnect *ProxyDisconnect) {
+	switch {
+	case disconnect != nil:
+		c.JSON(http.StatusOK, gin.H{"disconnect": disconnect})
+	case proxyErr != nil:
+		c.JSON(http.StatusOK, gin.H{"error": proxyErr})
+	default:
+		c.JSON(http.StatusOK, gin.H{"result": result})
+	}
+}
+
+// verifyProxyAPIKey is middleware that checks the optional shared X-API-Key
+// header Centrifugo can be configured to send with proxy requests. When
+// centrifugoConfig.ProxyAPIKey is empty the check is skipped, matching the
+// demo's default of trusting the network path to Centrifugo.
+func verifyProxyAPIKey(c *gin.Context) {
+	if centrifugoConfig.ProxyAPIKey == "" {
+		c.Next()
+		return
+	}
+
+	if c.GetHeader("X-API-Key") != centrifugoConfig.ProxyAPIKey {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid proxy API key"})
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+// ConnectProxyRequest is the body Centrifugo posts to the connect proxy.
+type ConnectProxyRequest struct {
+	Client    string          `json:"client"`
+	Transport string          `json:"transport"`
+	Protocol  string          `json:"protocol"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Version   string          `json:"version,omitempty"`
+}
+
+// ConnectProxyResult authorizes the connection and optionally grants it
+// server-side subscriptions, mirroring the connect proxy result schema.
+type ConnectProxyResult struct {
+	User     string                      `json:"user"`
+	ExpireAt int64                       `json:"expire_at,omitempty"`
+	Info     map[string]interface{}      `json:"info,omitempty"`
+	Data     json.RawMessage             `json:"data,omitempty"`
+	Channels []string                    `json:"channels,omitempty"`
+	Subs     map[string]SubscribeOptions `json:"subs,omitempty"`
+}
+
+// SubscribeProxyRequest is the body Centrifugo posts to the subscribe proxy.
+type SubscribeProxyRequest struct {
+	Client    string          `json:"client"`
+	Transport string          `json:"transport"`
+	Protocol  string          `json:"protocol"`
+	User      string          `json:"user"`
+	Channel   string          `json:"channel"`
+	Token     string          `json:"token,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// SubscribeProxyResult authorizes the subscribe and optionally overrides
+// channel options for this particular subscription.
+type SubscribeProxyResult struct {
+	ExpireAt int64                  `json:"expire_at,omitempty"`
+	Info     map[string]interface{} `json:"info,omitempty"`
+	Data     json.RawMessage        `json:"data,omitempty"`
+	Override *ChannelOverride       `json:"override,omitempty"`
+}
+
+// PublishProxyRequest is the body Centrifugo posts to the publish proxy.
+type PublishProxyRequest struct {
+	Client    string          `json:"client"`
+	Transport string          `json:"transport"`
+	Protocol  string          `json:"protocol"`
+	User      string          `json:"user"`
+	Channel   string          `json:"channel"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// PublishProxyResult optionally rewrites the data Centrifugo will publish;
+// an empty result leaves the published data unchanged.
+type PublishProxyResult struct {
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// RefreshProxyRequest is the body Centrifugo posts to the refresh proxy.
+type RefreshProxyRequest struct {
+	Client    string `json:"client"`
+	Transport string `json:"transport"`
+	Protocol  string `json:"protocol"`
+	User      string `json:"user"`
+}
+
+// RefreshProxyResult extends the connection's lifetime.
+type RefreshProxyResult struct {
+	ExpireAt int64                  `json:"expire_at,omitempty"`
+	Info     map[string]interface{} `json:"info,omitempty"`
+}
+
+// SubRefreshProxyRequest is the body Centrifugo posts to the sub_refresh
+// proxy.
+type SubRefreshProxyRequest struct {
+	Client    string `json:"client"`
+	Transport string `json:"transport"`
+	Protocol  string `json:"protocol"`
+	User      string `json:"user"`
+	Channel   string `json:"channel"`
+}
+
+// SubRefreshProxyResult extends a single subscription's lifetime.
+type SubRefreshProxyResult struct {
+	ExpireAt int64                  `json:"expire_at,omitempty"`
+	Info     map[string]interface{} `json:"info,omitempty"`
+}
+
+// ConnectProxyHandler decides whether a new connection is authorized and
+// what, if anything, it should be server-side subscribed to.
+type ConnectProxyHandler interface {
+	HandleConnect(req ConnectProxyRequest) (*ConnectProxyResult, *ProxyError, *ProxyDisconnect)
+}
+
+// SubscribeProxyHandler decides whether a client may subscribe to a channel.
+type SubscribeProxyHandler interface {
+	HandleSubscribe(req SubscribeProxyRequest) (*SubscribeProxyResult, *ProxyError, *ProxyDisconnect)
+}
+
+// PublishProxyHandler decides whether a client-originated publish is allowed
+// and may rewrite its payload before Centrifugo fans it out.
+type PublishProxyHandler interface {
+	HandlePublish(req PublishProxyRequest) (*PublishProxyResult, *ProxyError, *ProxyDisconnect)
+}
+
+// defaultProxyHandler is the demo's ACL: every connection is accepted, with
+// its client ID used as the user, and may subscribe to or publish on any
+// channel tokenPolicy allows.
+type defaultProxyHandler struct{}
+
+var proxyHandler = defaultProxyHandler{}
+
+func (defaultProxyHandler) HandleConnect(req ConnectProxyRequest) (*ConnectProxyResult, *ProxyError, *ProxyDisconnect) {
+	return &ConnectProxyResult{User: req.Client}, nil, nil
+}
+
+func (defaultProxyHandler) HandleSubscribe(req SubscribeProxyRequest) (*SubscribeProxyResult, *ProxyError, *ProxyDisconnect) {
+	if !isAllowedProxyChannel(req.Channel) {
+		return nil, &ProxyError{Code: 103, Message: "permission denied"}, nil
+	}
+	return &SubscribeProxyResult{}, nil, nil
+}
+
+func (defaultProxyHandler) HandlePublish(req PublishProxyRequest) (*PublishProxyResult, *ProxyError, *ProxyDisconnect) {
+	if !isAllowedProxyChannel(req.Channel) {
+		return nil, &ProxyError{Code: 103, Message: "permission denied"}, nil
+	}
+	return &PublishProxyResult{}, nil, nil
+}
+
+// isAllowedProxyChannel strips the "topic:" namespace prefix Centrifugo
+// channels use in this app and checks the bare topic against tokenPolicy.
+func isAllowedProxyChannel(channel string) bool {
+	const prefix = "topic:"
+	if len(channel) <= len(prefix) || channel[:len(prefix)] != prefix {
+		return false
+	}
+	return tokenPolicy.isAllowedChannel(channel[len(prefix):])
+}
+
+func proxyConnect(c *gin.Context) {
+	var req ConnectProxyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	result, proxyErr, disconnect := proxyHandler.HandleConnect(req)
+	writeProxyResponse(c, result, proxyErr, disconnect)
+}
+
+func proxySubscribe(c *gin.Context) {
+	var req SubscribeProxyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	result, proxyErr, disconnect := proxyHandler.HandleSubscribe(req)
+	writeProxyResponse(c, result, proxyErr, disconnect)
+}
+
+func proxyPublish(c *gin.Context) {
+	var req PublishProxyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	result, proxyErr, disconnect := proxyHandler.HandlePublish(req)
+	writeProxyResponse(c, result, proxyErr, disconnect)
+}
+
+func proxyRefresh(c *gin.Context) {
+	var req RefreshProxyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	writeProxyResponse(c, &RefreshProxyResult{
+		ExpireAt: time.Now().Add(tokenPolicy.DefaultTTL).Unix(),
+	}, nil, nil)
+}
+
+func proxySubRefresh(c *gin.Context) {
+	var req SubRefreshProxyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if !isAllowedProxyChannel(req.Channel) {
+		writeProxyResponse(c, nil, &ProxyError{Code: 103, Message: "permission denied"}, nil)
+		return
+	}
+
+	writeProxyResponse(c, &SubRefreshProxyResult{
+		ExpireAt: time.Now().Add(tokenPolicy.DefaultTTL).Unix(),
+	}, nil, nil)
+}
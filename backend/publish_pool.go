@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// publishWorkers and publishQueueSize size the bounded pool that fans
+// sendMessage's publishes out to Centrifugo; both are configurable so
+// deployments can tune throughput vs. memory without a code change.
+var (
+	publishWorkers   = getEnvInt("PUBLISH_WORKERS", 4)
+	publishQueueSize = getEnvInt("PUBLISH_QUEUE_SIZE", 64)
+
+	circuitBreakerThreshold = getEnvInt("CIRCUIT_BREAKER_THRESHOLD", 5)
+	circuitBreakerCooldown  = 10 * time.Second
+)
+
+// getEnvInt reads an integer environment variable, falling back to
+// defaultValue when unset or unparsable.
+func getEnvInt(key string, defaultValue int) int {
+	value := getEnv(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue
+	}
+	return n
+}
+
+// circuitBreaker trips after a configurable run of consecutive publish
+// failures and stays open for circuitBreakerCooldown, so a struggling
+// Centrifugo instance fails fast instead of piling up blocked requests.
+type circuitBreaker struct {
+	mu                  sync.Mutex
+	threshold           int
+	cooldown            time.Duration
+	consecutiveFailures int
+	openedAt            time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a new publish may proceed. It also clears an open
+// breaker once the cooldown has elapsed, giving the next call a chance to
+// prove Centrifugo has recovered.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if time.Since(b.openedAt) >= b.cooldown {
+		b.openedAt = time.Time{}
+		b.consecutiveFailures = 0
+		return true
+	}
+	return false
+}
+
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.consecutiveFailures = 0
+	b.openedAt = time.Time{}
+}
+
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.consecutiveFailures++
+	if b.consecutiveFailures >= b.threshold && b.openedAt.IsZero() {
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.openedAt.IsZero()
+}
+
+// publishMetrics accumulates the counters served at /metrics.
+type publishMetrics struct {
+	successTotal     uint64
+	failureTotal     uint64
+	latencySumMicros uint64
+	latencyCount     uint64
+}
+
+func (m *publishMetrics) observe(d time.Duration, success bool) {
+	if success {
+		atomic.AddUint64(&m.successTotal, 1)
+	} else {
+		atomic.AddUint64(&m.failureTotal, 1)
+	}
+	atomic.AddUint64(&m.latencySumMicros, uint64(d.Microseconds()))
+	atomic.AddUint64(&m.latencyCount, 1)
+}
+
+// publishJob is one unit of work submitted to the pool: either a single
+// Publish to channel, or a Batch of distinct publish commands sent to
+// Centrifugo in one HTTP round trip.
+type publishJob struct {
+	channel  string
+	data     interface{}
+	commands []BatchCommand
+	done     chan publishJobResult
+}
+
+type publishJobResult struct {
+	result *PublishResult
+	batch  *BatchResult
+	err    error
+}
+
+// PublishPool bounds how many publishes to Centrifugo are in flight at
+// once, while keeping per-channel ordering by always routing a given
+// channel's jobs to the same worker queue.
+type PublishPool struct {
+	queues  []chan publishJob
+	breaker *circuitBreaker
+	metrics *publishMetrics
+}
+
+// NewPublishPool starts workerCount goroutines, each draining its own
+// bounded queue of size queueSize.
+func NewPublishPool(workerCount, queueSize int) *PublishPool {
+	p := &PublishPool{
+		queues:  make([]chan publishJob, workerCount),
+		breaker: newCircuitBreaker(circuitBreakerThreshold, circuitBreakerCooldown),
+		metrics: &publishMetrics{},
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan publishJob, queueSize)
+		go p.worker(p.queues[i])
+	}
+	return p
+}
+
+func (p *PublishPool) worker(queue chan publishJob) {
+	for job := range queue {
+		start := time.Now()
+		var res publishJobResult
+		if job.commands != nil {
+			res.batch, res.err = centrifugoClient.Batch(job.commands)
+		} else {
+			res.result, res.err = centrifugoClient.Publish(job.channel, job.data)
+		}
+		p.metrics.observe(time.Since(start), res.err == nil)
+		if res.err == nil {
+			p.breaker.recordSuccess()
+		} else {
+			p.breaker.recordFailure()
+		}
+		job.done <- res
+	}
+}
+
+// queueFor returns the worker queue responsible for channel, so repeated
+// publishes to the same channel are always processed in submission order.
+func (p *PublishPool) queueFor(channel string) chan publishJob {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(channel))
+	return p.queues[h.Sum32()%uint32(len(p.queues))]
+}
+
+var errCircuitOpen = fmt.Errorf("publish circuit breaker is open")
+var errQueueFull = fmt.Errorf("publish queue is full")
+
+// Publish enqueues a single-channel publish and blocks for its result.
+func (p *PublishPool) Publish(channel string, data interface{}) (*PublishResult, error) {
+	if !p.breaker.allow() {
+		return nil, errCircuitOpen
+	}
+
+	done := make(chan publishJobResult, 1)
+	job := publishJob{channel: channel, data: data, done: done}
+
+	select {
+	case p.queueFor(channel) <- job:
+	default:
+		return nil, errQueueFull
+	}
+
+	res := <-done
+	return res.result, res.err
+}
+
+// PublishBatch enqueues a set of distinct publish commands (e.g. the same
+// message encrypted separately per destination channel), replacing what
+// would otherwise be one HTTP round trip per channel. Commands are grouped
+// by queueFor(channel) and submitted as one sub-batch per queue, so a given
+// channel's commands always land on the same worker queue as its individual
+// Publish calls do — preserving per-channel ordering even when one caller's
+// batch spans several destination channels and another caller's batch
+// shares one of them (e.g. the "all" aggregate channel).
+func (p *PublishPool) PublishBatch(commands []BatchCommand) (*BatchResult, error) {
+	if len(commands) == 0 {
+		return &BatchResult{}, nil
+	}
+	if !p.breaker.allow() {
+		return nil, errCircuitOpen
+	}
+
+	type subBatch struct {
+		indices  []int
+		commands []BatchCommand
+		done     chan publishJobResult
+	}
+
+	subBatches := make(map[chan publishJob]*subBatch)
+	var queues []chan publishJob
+	for i, cmd := range commands {
+		q := p.queueFor(cmd.Publish.Channel)
+		sb, ok := subBatches[q]
+		if !ok {
+			sb = &subBatch{done: make(chan publishJobResult, 1)}
+			subBatches[q] = sb
+			queues = append(queues, q)
+		}
+		sb.indices = append(sb.indices, i)
+		sb.commands = append(sb.commands, cmd)
+	}
+
+	for _, q := range queues {
+		sb := subBatches[q]
+		select {
+		case q <- (publishJob{commands: sb.commands, done: sb.done}):
+		default:
+			return nil, errQueueFull
+		}
+	}
+
+	replies := make([]BatchReply, len(commands))
+	for _, q := range queues {
+		sb := subBatches[q]
+		res := <-sb.done
+		if res.err != nil {
+			return nil, res.err
+		}
+		for j, idx := range sb.indices {
+			if j < len(res.batch.Replies) {
+				replies[idx] = res.batch.Replies[j]
+			}
+		}
+	}
+
+	return &BatchResult{Replies: replies}, nil
+}
+
+var publishPool = NewPublishPool(publishWorkers, publishQueueSize)
+
+// metricsHandler serves the publish counters in Prometheus text exposition
+// format at GET /metrics.
+func metricsHandler(c *gin.Context) {
+	m := publishPool.metrics
+	success := atomic.LoadUint64(&m.successTotal)
+	failure := atomic.LoadUint64(&m.failureTotal)
+	latencySumMicros := atomic.LoadUint64(&m.latencySumMicros)
+	latencyCount := atomic.LoadUint64(&m.latencyCount)
+
+	breakerOpen := 0
+	if publishPool.breaker.isOpen() {
+		breakerOpen = 1
+	}
+
+	body := fmt.Sprintf(`# HELP centrifugo_publish_total Total number of publish/batch attempts to Centrifugo.
+# TYPE centrifugo_publish_total counter
+centrifugo_publish_total{status="success"} %d
+centrifugo_publish_total{status="failure"} %d
+# HELP centrifugo_publish_latency_seconds_sum Sum of publish/batch call latencies.
+# TYPE centrifugo_publish_latency_seconds_sum counter
+centrifugo_publish_latency_seconds_sum %f
+# HELP centrifugo_publish_latency_seconds_count Count of publish/batch calls observed.
+# TYPE centrifugo_publish_latency_seconds_count counter
+centrifugo_publish_latency_seconds_count %d
+# HELP centrifugo_circuit_breaker_open Whether the publish circuit breaker is currently open (1) or closed (0).
+# TYPE centrifugo_circuit_breaker_open gauge
+centrifugo_circuit_breaker_open %d
+`, success, failure, float64(latencySumMicros)/1e6, latencyCount, breakerOpen)
+
+	c.String(http.StatusOK, body)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	b := newCircuitBreaker(3, 50*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		b.recordFailure()
+		if !b.allow() {
+			t.Fatalf("breaker should remain closed after %d failures", i+1)
+		}
+	}
+
+	b.recordFailure()
+	if b.allow() {
+		t.Fatal("breaker should be open once the failure threshold is reached")
+	}
+	if !b.isOpen() {
+		t.Fatal("isOpen should report true once the breaker has tripped")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("breaker should allow requests again once the cooldown has elapsed")
+	}
+}
+
+func TestCircuitBreakerRecordSuccessResetsFailures(t *testing.T) {
+	b := newCircuitBreaker(2, time.Second)
+
+	b.recordFailure()
+	b.recordSuccess()
+	b.recordFailure()
+
+	if !b.allow() {
+		t.Fatal("a single failure after a recorded success should not trip the breaker")
+	}
+}
+
+// withFakeCentrifugo points centrifugoClient at a test server for the
+// duration of the test and restores the original client on cleanup.
+func withFakeCentrifugo(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	original := centrifugoClient
+	centrifugoClient = NewCentrifugoClient(CentrifugoConfig{URL: server.URL, APIKey: "test"})
+	t.Cleanup(func() { centrifugoClient = original })
+}
+
+func TestPublishPoolPublish(t *testing.T) {
+	withFakeCentrifugo(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/publish" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": map[string]interface{}{"offset": 1, "epoch": "e1"},
+		})
+	})
+
+	pool := NewPublishPool(2, 4)
+	result, err := pool.Publish("topic:general", map[string]string{"hello": "world"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Offset != 1 || result.Epoch != "e1" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestPublishPoolPublishBatch(t *testing.T) {
+	withFakeCentrifugo(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/batch" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		var req struct {
+			Commands []BatchCommand `json:"commands"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		replies := make([]map[string]interface{}, len(req.Commands))
+		for i := range req.Commands {
+			replies[i] = map[string]interface{}{
+				"publish": map[string]interface{}{"result": map[string]interface{}{"offset": i + 1}},
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": map[string]interface{}{"replies": replies},
+		})
+	})
+
+	pool := NewPublishPool(2, 4)
+	commands := []BatchCommand{
+		{Publish: &PublishCommand{Channel: "topic:general", Data: "a"}},
+		{Publish: &PublishCommand{Channel: "topic:all", Data: "b"}},
+	}
+
+	result, err := pool.PublishBatch(commands)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Replies) != 2 {
+		t.Fatalf("expected 2 replies, got %d", len(result.Replies))
+	}
+	// The two commands may be submitted as one Centrifugo batch call or, if
+	// their channels route to different worker queues, as separate
+	// sub-batches — either way every command must come back with a result.
+	for i, reply := range result.Replies {
+		if reply.Publish == nil || reply.Publish.Result == nil {
+			t.Fatalf("reply %d missing a publish result: %+v", i, reply)
+		}
+	}
+}
+
+// TestPublishBatchPreservesPerChannelOrder posts to two different topics
+// concurrently, each batch also publishing to the shared "all" aggregate
+// channel, and asserts the "all" publishes still reach Centrifugo in
+// submission order — the ordering guarantee PublishBatch must uphold even
+// though "general" and "tech" may route to different worker queues than
+// "all" does.
+func TestPublishBatchPreservesPerChannelOrder(t *testing.T) {
+	var mu sync.Mutex
+	var allOrder []string
+
+	withFakeCentrifugo(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Commands []BatchCommand `json:"commands"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		for _, cmd := range req.Commands {
+			if cmd.Publish != nil && cmd.Publish.Channel == topicChannel("all") {
+				mu.Lock()
+				allOrder = append(allOrder, fmt.Sprint(cmd.Publish.Data))
+				mu.Unlock()
+			}
+		}
+
+		replies := make([]map[string]interface{}, len(req.Commands))
+		for i := range req.Commands {
+			replies[i] = map[string]interface{}{
+				"publish": map[string]interface{}{"result": map[string]interface{}{"offset": i + 1}},
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": map[string]interface{}{"replies": replies},
+		})
+	})
+
+	pool := NewPublishPool(4, 8)
+
+	batchFor := func(topic, marker string) []BatchCommand {
+		return []BatchCommand{
+			{Publish: &PublishCommand{Channel: topicChannel(topic), Data: marker}},
+			{Publish: &PublishCommand{Channel: topicChannel("all"), Data: marker}},
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if _, err := pool.PublishBatch(batchFor("general", "first")); err != nil {
+			t.Errorf("first publish failed: %v", err)
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		defer wg.Done()
+		if _, err := pool.PublishBatch(batchFor("tech", "second")); err != nil {
+			t.Errorf("second publish failed: %v", err)
+		}
+	}()
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(allOrder) != 2 || allOrder[0] != "first" || allOrder[1] != "second" {
+		t.Fatalf("expected topic:all publishes in submission order [first second], got %v", allOrder)
+	}
+}
+
+// fakePublishServer simulates a Centrifugo node that takes latency to
+// respond to every publish, so the benchmarks below show a real throughput
+// difference between issuing calls one at a time and fanning them out
+// through the pool.
+func fakePublishServer(latency time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(latency)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": map[string]interface{}{"offset": 1, "epoch": "e1"},
+		})
+	}))
+}
+
+// BenchmarkSequentialPublish mirrors the one-request-per-channel loop that
+// sendMessage used before the publish pool: every channel is published to
+// one at a time.
+func BenchmarkSequentialPublish(b *testing.B) {
+	server := fakePublishServer(2 * time.Millisecond)
+	defer server.Close()
+
+	client := NewCentrifugoClient(CentrifugoConfig{URL: server.URL, APIKey: "test"})
+	topics := []string{"general", "tech", "random", "announcements", "all"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, topic := range topics {
+			if _, err := client.Publish("topic:"+topic, "x"); err != nil {
+				b.Fatalf("publish failed: %v", err)
+			}
+		}
+	}
+}
+
+// BenchmarkPooledPublish submits the same N channel publishes as a single
+// PublishBatch call, the code path sendMessage actually uses, demonstrating
+// its throughput win over issuing one publish request per channel.
+func BenchmarkPooledPublish(b *testing.B) {
+	server := fakePublishServer(2 * time.Millisecond)
+	defer server.Close()
+
+	original := centrifugoClient
+	centrifugoClient = NewCentrifugoClient(CentrifugoConfig{URL: server.URL, APIKey: "test"})
+	defer func() { centrifugoClient = original }()
+
+	pool := NewPublishPool(5, 10)
+	topics := []string{"general", "tech", "random", "announcements", "all"}
+	commands := make([]BatchCommand, len(topics))
+	for i, topic := range topics {
+		commands[i] = BatchCommand{Publish: &PublishCommand{Channel: "topic:" + topic, Data: "x"}}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := pool.PublishBatch(commands); err != nil {
+			b.Fatalf("publish batch failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenPolicy bounds what a connection or subscription token request is
+// allowed to ask for, so TTLs and channel access stay configurable without
+// hardcoding them into generateToken.
+type TokenPolicy struct {
+	DefaultTTL      time.Duration
+	MaxTTL          time.Duration
+	AllowedChannels []string
+}
+
+var tokenPolicy = TokenPolicy{
+	DefaultTTL:      24 * time.Hour,
+	MaxTTL:          7 * 24 * time.Hour,
+	AllowedChannels: []string{"all", "general", "tech", "random", "announcements"},
+}
+
+// ttl resolves the requested TTL (in seconds) against the policy, falling
+// back to DefaultTTL when unset and clamping to MaxTTL.
+func (p TokenPolicy) ttl(requestedSeconds int) time.Duration {
+	if requestedSeconds <= 0 {
+		return p.DefaultTTL
+	}
+	requested := time.Duration(requestedSeconds) * time.Second
+	if requested > p.MaxTTL {
+		return p.MaxTTL
+	}
+	return requested
+}
+
+// isAllowedChannel reports whether topic may be granted in a server-side
+// "channels" or "subs" claim.
+func (p TokenPolicy) isAllowedChannel(topic string) bool {
+	for _, allowed := range p.AllowedChannels {
+		if allowed == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// ChannelOverride mirrors Centrifugo's per-channel "override" block, letting
+// a token enable or disable presence/join_leave/position for one channel
+// regardless of the namespace default.
+type ChannelOverride struct {
+	Presence  *bool `json:"presence,omitempty"`
+	JoinLeave *bool `json:"join_leave,omitempty"`
+	Position  *bool `json:"position,omitempty"`
+}
+
+// SubscribeOptions is the value type of a connection token's "subs" claim:
+// per-channel options applied when Centrifugo server-side subscribes the
+// client to that channel.
+type SubscribeOptions struct {
+	Info     map[string]interface{} `json:"info,omitempty"`
+	Override *ChannelOverride       `json:"override,omitempty"`
+}
+
+// TokenRequest is the body of POST /api/token.
+type TokenRequest struct {
+	User       string                      `json:"user"`
+	Info       map[string]interface{}      `json:"info,omitempty"`
+	Channels   []string                    `json:"channels,omitempty"`
+	Subs       map[string]SubscribeOptions `json:"subs,omitempty"`
+	TTLSeconds int                         `json:"ttl_seconds,omitempty"`
+}
+
+// TokenResponse is the response of POST /api/token.
+type TokenResponse struct {
+	Token string `json:"token"`
+}
+
+// generateToken issues a Centrifugo connection token for req.User, carrying
+// optional user info, a server-side subscribe list and per-channel
+// subscription overrides. Channels outside tokenPolicy.AllowedChannels are
+// silently dropped rather than rejecting the whole request.
+func generateToken(req TokenRequest) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": req.User,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(tokenPolicy.ttl(req.TTLSeconds)).Unix(),
+	}
+
+	if len(req.Info) > 0 {
+		claims["info"] = req.Info
+	}
+
+	if len(req.Channels) > 0 {
+		var channels []string
+		for _, channel := range req.Channels {
+			if tokenPolicy.isAllowedChannel(channel) {
+				channels = append(channels, topicChannel(channel))
+			}
+		}
+		if len(channels) > 0 {
+			claims["channels"] = channels
+		}
+	}
+
+	if len(req.Subs) > 0 {
+		subs := make(map[string]SubscribeOptions, len(req.Subs))
+		for channel, opts := range req.Subs {
+			if tokenPolicy.isAllowedChannel(channel) {
+				subs[topicChannel(channel)] = opts
+			}
+		}
+		if len(subs) > 0 {
+			claims["subs"] = subs
+		}
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	tokenString, err := token.SignedString([]byte(centrifugoConfig.TokenHMACSecretKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %v", err)
+	}
+
+	return tokenString, nil
+}
+
+func getToken(c *gin.Context) {
+	var req TokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if req.User == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User is required"})
+		return
+	}
+
+	token, err := generateToken(req)
+	if err != nil {
+		log.Printf("Failed to generate token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TokenResponse{Token: token})
+}
+
+// SubscriptionTokenRequest is the body of POST /api/subscription_token, used
+// to authorize a client-side subscribe to a private channel per Centrifugo's
+// subscription token contract.
+type SubscriptionTokenRequest struct {
+	Channel    string                 `json:"channel"`
+	Client     string                 `json:"client"`
+	Info       map[string]interface{} `json:"info,omitempty"`
+	B64Info    string                 `json:"b64info,omitempty"`
+	TTLSeconds int                    `json:"ttl_seconds,omitempty"`
+}
+
+// SubscriptionTokenResponse is the response of POST /api/subscription_token.
+type SubscriptionTokenResponse struct {
+	Token string `json:"token"`
+}
+
+// generateSubscriptionToken issues a Centrifugo subscription token binding a
+// specific client connection to a specific channel.
+func generateSubscriptionToken(req SubscriptionTokenRequest) (string, error) {
+	claims := jwt.MapClaims{
+		"channel": req.Channel,
+		"client":  req.Client,
+		"iat":     time.Now().Unix(),
+		"exp":     time.Now().Add(tokenPolicy.ttl(req.TTLSeconds)).Unix(),
+	}
+
+	if len(req.Info) > 0 {
+		claims["info"] = req.Info
+	}
+	if req.B64Info != "" {
+		claims["b64info"] = req.B64Info
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	tokenString, err := token.SignedString([]byte(centrifugoConfig.TokenHMACSecretKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign subscription token: %v", err)
+	}
+
+	return tokenString, nil
+}
+
+func getSubscriptionToken(c *gin.Context) {
+	var req SubscriptionTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if req.Channel == "" || req.Client == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Channel and client are required"})
+		return
+	}
+
+	if !tokenPolicy.isAllowedChannel(req.Channel) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Channel is not allowed"})
+		return
+	}
+
+	token, err := generateSubscriptionToken(SubscriptionTokenRequest{
+		Channel:    topicChannel(req.Channel),
+		Client:     req.Client,
+		Info:       req.Info,
+		B64Info:    req.B64Info,
+		TTLSeconds: req.TTLSeconds,
+	})
+	if err != nil {
+		log.Printf("Failed to generate subscription token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate subscription token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SubscriptionTokenResponse{Token: token})
+}
+
+// authUserContextKey is the Gin context key requireToken stores the
+// authenticated user under.
+const authUserContextKey = "authUser"
+
+// requireToken is minimal bearer-auth middleware for endpoints that must not
+// be reachable by anyone who merely knows a topic name: it verifies the
+// Authorization header carries a connection token previously issued by
+// generateToken, signed with the same HMAC secret, and not expired.
+func requireToken(c *gin.Context) {
+	header := c.GetHeader("Authorization")
+	tokenString := strings.TrimPrefix(header, "Bearer ")
+	if tokenString == "" || tokenString == header {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing bearer token"})
+		c.Abort()
+		return
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return []byte(centrifugoConfig.TokenHMACSecretKey), nil
+	})
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return
+	}
+
+	// Subscription tokens share the HMAC secret but carry no "sub" claim, so
+	// a missing subject is what tells them apart from connection tokens.
+	user, ok := claims["sub"].(string)
+	if !ok || user == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return
+	}
+	c.Set(authUserContextKey, user)
+
+	c.Next()
+}